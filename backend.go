@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/sashabaranov/go-openai"
+	"gopkg.in/yaml.v3"
+)
+
+// Backend abstracts over an LLM/embedding provider so the RAG pipeline can
+// mix Ollama, OpenAI, Anthropic and llama.cpp-server models without
+// recompiling.
+type Backend interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Chat asks the backend for a completion. temperature of 0 means "use
+	// the provider's default" - it's left out of the request rather than
+	// sent as an explicit 0.
+	Chat(ctx context.Context, messages []openai.ChatCompletionMessage, temperature float32) (string, error)
+}
+
+// StreamingBackend is implemented by backends that can progressively
+// deliver generated tokens as they arrive.
+type StreamingBackend interface {
+	Backend
+	ChatStream(ctx context.Context, messages []openai.ChatCompletionMessage, temperature float32, onToken func(string)) error
+}
+
+// ModelConfig describes one entry of models.yaml: how to reach a backend
+// and which model to ask it for.
+type ModelConfig struct {
+	Name           string `yaml:"name"`
+	Type           string `yaml:"type"`    // "chat" or "embedding"
+	Backend        string `yaml:"backend"` // "ollama", "openai", "anthropic", "llamacpp"
+	BaseURL        string `yaml:"base_url"`
+	APIKeyEnv      string `yaml:"api_key_env"`
+	Model          string `yaml:"model"`
+	PromptTemplate string `yaml:"prompt_template"`
+}
+
+type modelsFile struct {
+	Models []ModelConfig `yaml:"models"`
+}
+
+// defaultModelsConfig is used when no models.yaml is present, so the
+// service keeps working against a local Ollama instance out of the box.
+var defaultModelsConfig = modelsFile{
+	Models: []ModelConfig{
+		{Name: llmModel, Type: "chat", Backend: "ollama", BaseURL: ollamaBaseURL, Model: llmModel},
+		{Name: embeddingModel, Type: "embedding", Backend: "ollama", BaseURL: ollamaBaseURL, Model: embeddingModel},
+	},
+}
+
+// Registry holds the configured chat and embedding backends, keyed by
+// model name, along with which one to fall back to when a request doesn't
+// specify a model.
+type Registry struct {
+	chat             map[string]Backend
+	embedding        map[string]Backend
+	promptTemplate   map[string]string
+	defaultChatName  string
+	defaultEmbedding string
+}
+
+// loadRegistry reads the single YAML file at path (models.yaml) and builds
+// a Registry; a directory of per-model YAML files is not read. If path does not exist, it falls back to
+// defaultModelsConfig so the app still runs against a local Ollama.
+func loadRegistry(path string) (*Registry, error) {
+	mf := defaultModelsConfig
+	if data, err := os.ReadFile(path); err == nil {
+		mf = modelsFile{}
+		if err := yaml.Unmarshal(data, &mf); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	reg := &Registry{
+		chat:           map[string]Backend{},
+		embedding:      map[string]Backend{},
+		promptTemplate: map[string]string{},
+	}
+	for _, cfg := range mf.Models {
+		b, err := newBackend(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("model %q: %w", cfg.Name, err)
+		}
+		switch cfg.Type {
+		case "embedding":
+			reg.embedding[cfg.Name] = b
+			if reg.defaultEmbedding == "" {
+				reg.defaultEmbedding = cfg.Name
+			}
+		default:
+			reg.chat[cfg.Name] = b
+			reg.promptTemplate[cfg.Name] = cfg.PromptTemplate
+			if reg.defaultChatName == "" {
+				reg.defaultChatName = cfg.Name
+			}
+		}
+	}
+	return reg, nil
+}
+
+func newBackend(cfg ModelConfig) (Backend, error) {
+	apiKey := ""
+	if cfg.APIKeyEnv != "" {
+		apiKey = os.Getenv(cfg.APIKeyEnv)
+	}
+	switch cfg.Backend {
+	case "ollama", "openai", "llamacpp":
+		return newOpenAICompatBackend(cfg.BaseURL, apiKey, cfg.Model), nil
+	case "anthropic":
+		return newAnthropicBackend(apiKey, cfg.Model), nil
+	default:
+		return nil, fmt.Errorf("unknown backend type %q", cfg.Backend)
+	}
+}
+
+// Chat returns the backend for the given request model, falling back to the
+// registry default when name is empty.
+func (r *Registry) Chat(name string) (Backend, error) {
+	if name == "" {
+		name = r.defaultChatName
+	}
+	b, ok := r.chat[name]
+	if !ok {
+		return nil, fmt.Errorf("no chat backend configured for model %q", name)
+	}
+	return b, nil
+}
+
+// PromptTemplate returns the prompt_template configured for the given chat
+// model name (falling back to the registry default when name is empty), or
+// "" if that model didn't set one.
+func (r *Registry) PromptTemplate(name string) string {
+	if name == "" {
+		name = r.defaultChatName
+	}
+	return r.promptTemplate[name]
+}
+
+// Embedding returns the backend for the given embedding model name,
+// falling back to the registry default when name is empty.
+func (r *Registry) Embedding(name string) (Backend, error) {
+	if name == "" {
+		name = r.defaultEmbedding
+	}
+	b, ok := r.embedding[name]
+	if !ok {
+		return nil, fmt.Errorf("no embedding backend configured for model %q", name)
+	}
+	return b, nil
+}
+
+// ChatModelNames lists the configured chat model names.
+func (r *Registry) ChatModelNames() []string {
+	names := make([]string, 0, len(r.chat))
+	for name := range r.chat {
+		names = append(names, name)
+	}
+	return names
+}
+
+// EmbeddingModelNames lists the configured embedding model names.
+func (r *Registry) EmbeddingModelNames() []string {
+	names := make([]string, 0, len(r.embedding))
+	for name := range r.embedding {
+		names = append(names, name)
+	}
+	return names
+}
+
+// openAICompatBackend talks to any provider that speaks the OpenAI HTTP
+// API, which covers Ollama, OpenAI itself, and llama.cpp-server.
+type openAICompatBackend struct {
+	client *openai.Client
+	model  string
+}
+
+func newOpenAICompatBackend(baseURL, apiKey, model string) *openAICompatBackend {
+	cfg := openai.DefaultConfig(apiKey)
+	if baseURL != "" {
+		cfg.BaseURL = baseURL
+	}
+	cfg.HTTPClient = http.DefaultClient
+	return &openAICompatBackend{client: openai.NewClientWithConfig(cfg), model: model}
+}
+
+func (b *openAICompatBackend) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	resp, err := b.client.CreateEmbeddings(ctx, openai.EmbeddingRequest{
+		Input: texts,
+		Model: openai.EmbeddingModel(b.model),
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([][]float32, len(resp.Data))
+	for i, d := range resp.Data {
+		out[i] = d.Embedding
+	}
+	return out, nil
+}
+
+func (b *openAICompatBackend) Chat(ctx context.Context, messages []openai.ChatCompletionMessage, temperature float32) (string, error) {
+	res, err := b.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model:       b.model,
+		Messages:    messages,
+		Temperature: temperature,
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(res.Choices) == 0 {
+		return "", fmt.Errorf("%s: empty response", b.model)
+	}
+	return res.Choices[0].Message.Content, nil
+}
+
+func (b *openAICompatBackend) ChatStream(ctx context.Context, messages []openai.ChatCompletionMessage, temperature float32, onToken func(string)) error {
+	stream, err := b.client.CreateChatCompletionStream(ctx, openai.ChatCompletionRequest{
+		Model:       b.model,
+		Messages:    messages,
+		Temperature: temperature,
+		Stream:      true,
+	})
+	if err != nil {
+		return err
+	}
+	defer stream.Close()
+
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(resp.Choices) > 0 {
+			onToken(resp.Choices[0].Delta.Content)
+		}
+	}
+}
+
+// anthropicBackend talks to the Anthropic Messages API directly, since it
+// predates and doesn't follow the OpenAI schema. It only supports chat;
+// Anthropic has no embeddings endpoint.
+type anthropicBackend struct {
+	apiKey string
+	model  string
+}
+
+func newAnthropicBackend(apiKey, model string) *anthropicBackend {
+	return &anthropicBackend{apiKey: apiKey, model: model}
+}
+
+func (b *anthropicBackend) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	return nil, fmt.Errorf("anthropic backend does not support embeddings")
+}
+
+func (b *anthropicBackend) Chat(ctx context.Context, messages []openai.ChatCompletionMessage, temperature float32) (string, error) {
+	var system string
+	type anthropicMessage struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	}
+	var anthropicMessages []anthropicMessage
+	for _, m := range messages {
+		if m.Role == openai.ChatMessageRoleSystem {
+			system = m.Content
+			continue
+		}
+		anthropicMessages = append(anthropicMessages, anthropicMessage{Role: m.Role, Content: m.Content})
+	}
+
+	payload := map[string]interface{}{
+		"model":      b.model,
+		"system":     system,
+		"messages":   anthropicMessages,
+		"max_tokens": 1024,
+	}
+	if temperature != 0 {
+		payload["temperature"] = temperature
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://api.anthropic.com/v1/messages", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("x-api-key", b.apiKey)
+	req.Header.Set("anthropic-version", "2023-06-01")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var out struct {
+		Content []struct {
+			Text string `json:"text"`
+		} `json:"content"`
+		Error *struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return "", err
+	}
+	if out.Error != nil {
+		return "", fmt.Errorf("anthropic: %s", out.Error.Message)
+	}
+	if len(out.Content) == 0 {
+		return "", fmt.Errorf("anthropic: empty response")
+	}
+	return out.Content[0].Text, nil
+}
@@ -0,0 +1,206 @@
+// Package chunker splits documents into overlapping pieces small enough to
+// embed and retrieve individually.
+package chunker
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Strategy selects how a document is split into chunks.
+type Strategy string
+
+const (
+	// Fixed splits on a fixed number of characters.
+	Fixed Strategy = "fixed"
+	// Sentence splits on sentence boundaries, packing sentences into a
+	// chunk until the size budget is spent.
+	Sentence Strategy = "sentence"
+	// Recursive tries a list of separators from coarsest (paragraph) to
+	// finest (character), splitting only as much as needed to fit size.
+	Recursive Strategy = "recursive"
+)
+
+// Options configures a Split call. Size and Overlap are both measured in
+// characters.
+type Options struct {
+	Strategy Strategy
+	Size     int
+	Overlap  int
+}
+
+// DefaultOptions chunks at 1000 characters with 200 characters of overlap,
+// a reasonable middle ground for short wiki-style articles.
+var DefaultOptions = Options{Strategy: Recursive, Size: 1000, Overlap: 200}
+
+// Split breaks text into chunks according to opts. Empty or whitespace-only
+// chunks are dropped.
+func Split(text string, opts Options) []string {
+	if opts.Size <= 0 {
+		opts = DefaultOptions
+	}
+	if opts.Overlap < 0 || opts.Overlap >= opts.Size {
+		opts.Overlap = 0
+	}
+
+	var chunks []string
+	switch opts.Strategy {
+	case Sentence:
+		chunks = splitSentence(text, opts.Size, opts.Overlap)
+	case Recursive:
+		chunks = splitRecursive(text, opts.Size, opts.Overlap)
+	default:
+		chunks = splitFixed(text, opts.Size, opts.Overlap)
+	}
+
+	out := chunks[:0]
+	for _, c := range chunks {
+		if strings.TrimSpace(c) != "" {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// splitFixed slides a fixed-size window over text, advancing by
+// size-overlap runes each step.
+func splitFixed(text string, size, overlap int) []string {
+	runes := []rune(text)
+	if len(runes) == 0 {
+		return nil
+	}
+	step := size - overlap
+	if step <= 0 {
+		step = size
+	}
+
+	var chunks []string
+	for start := 0; start < len(runes); start += step {
+		end := start + size
+		if end > len(runes) {
+			end = len(runes)
+		}
+		chunks = append(chunks, string(runes[start:end]))
+		if end == len(runes) {
+			break
+		}
+	}
+	return chunks
+}
+
+// splitSentence packs whole sentences into chunks up to size characters,
+// repeating the trailing overlap characters of sentences at the start of
+// the next chunk so context isn't lost across the boundary.
+func splitSentence(text string, size, overlap int) []string {
+	sentences := splitSentences(text)
+	if len(sentences) == 0 {
+		return nil
+	}
+
+	var chunks []string
+	var current strings.Builder
+	for _, s := range sentences {
+		if current.Len() > 0 && utf8.RuneCountInString(current.String())+utf8.RuneCountInString(s) > size {
+			chunks = append(chunks, current.String())
+			carry := lastNChars(current.String(), overlap)
+			current.Reset()
+			current.WriteString(carry)
+		}
+		if current.Len() > 0 {
+			current.WriteString(" ")
+		}
+		current.WriteString(s)
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
+
+// splitSentences does a simple boundary split on '.', '!' and '?' followed
+// by whitespace - good enough for well-formed prose without pulling in a
+// full NLP tokenizer.
+func splitSentences(text string) []string {
+	var sentences []string
+	var current strings.Builder
+	runes := []rune(text)
+	for i, r := range runes {
+		current.WriteRune(r)
+		isBoundary := r == '.' || r == '!' || r == '?'
+		nextIsSpace := i+1 >= len(runes) || unicode.IsSpace(runes[i+1])
+		if isBoundary && nextIsSpace {
+			sentences = append(sentences, strings.TrimSpace(current.String()))
+			current.Reset()
+		}
+	}
+	if strings.TrimSpace(current.String()) != "" {
+		sentences = append(sentences, strings.TrimSpace(current.String()))
+	}
+	return sentences
+}
+
+// recursiveSeparators is tried in order, coarsest first, so the splitter
+// prefers to break along natural document boundaries before falling back
+// to splitting mid-word.
+var recursiveSeparators = []string{"\n\n", "\n", ". ", " ", ""}
+
+// splitRecursive splits on the first separator that yields pieces no
+// larger than size, recursing into any piece that's still too big, then
+// reassembles neighbouring pieces into size-bounded, overlap-joined
+// chunks.
+func splitRecursive(text string, size, overlap int) []string {
+	pieces := recursiveSplit(text, size, recursiveSeparators)
+
+	var chunks []string
+	var current strings.Builder
+	for _, p := range pieces {
+		if current.Len() > 0 && utf8.RuneCountInString(current.String())+utf8.RuneCountInString(p) > size {
+			chunks = append(chunks, current.String())
+			carry := lastNChars(current.String(), overlap)
+			current.Reset()
+			current.WriteString(carry)
+		}
+		current.WriteString(p)
+	}
+	if current.Len() > 0 {
+		chunks = append(chunks, current.String())
+	}
+	return chunks
+}
+
+func recursiveSplit(text string, size int, separators []string) []string {
+	if utf8.RuneCountInString(text) <= size || len(separators) == 0 {
+		return []string{text}
+	}
+
+	sep := separators[0]
+	rest := separators[1:]
+	var parts []string
+	if sep == "" {
+		parts = strings.Split(text, "")
+	} else {
+		parts = strings.SplitAfter(text, sep)
+	}
+
+	var out []string
+	for _, p := range parts {
+		if p == "" {
+			continue
+		}
+		if utf8.RuneCountInString(p) > size {
+			out = append(out, recursiveSplit(p, size, rest)...)
+		} else {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+func lastNChars(s string, n int) string {
+	runes := []rune(s)
+	if n <= 0 || n >= len(runes) {
+		return s
+	}
+	return string(runes[len(runes)-n:])
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gouravsinghbais/RAG-with-DefraDB/chunker"
+	"github.com/sourcenetwork/defradb/client"
+)
+
+// registerIngestionRoutes wires up the runtime document ingestion API, so
+// the knowledge base can grow without restarting the server or hand
+// preparing wiki.jsonl.
+func registerIngestionRoutes() {
+	http.HandleFunc("/documents", documentsHandler)
+	http.HandleFunc("/documents/", documentHandler)
+}
+
+// ingestDocumentReq is the payload accepted by POST /documents. Content
+// holds the raw document body (base64-encoded for the binary "pdf"
+// format); everything else is plain text and used as-is.
+type ingestDocumentReq struct {
+	Content       string `json:"content"`
+	Format        string `json:"format"` // "text", "markdown", "html", "pdf", "json"
+	Source        string `json:"source,omitempty"`
+	Category      string `json:"category,omitempty"`
+	ChunkStrategy string `json:"chunk_strategy,omitempty"`
+	ChunkSize     int    `json:"chunk_size,omitempty"`
+	ChunkOverlap  int    `json:"chunk_overlap,omitempty"`
+}
+
+type ingestDocumentResp struct {
+	ParentDocID string `json:"parent_doc_id"`
+	ChunkCount  int    `json:"chunk_count"`
+}
+
+// documentsHandler implements POST /documents: load the document with the
+// loader for its format, chunk it, and store one Wiki row per chunk. A
+// "json" payload is an array of articles instead, stored one row per article
+// without chunking. Each
+// row's text_v is left for the schema's @embedding directive to compute, the
+// same way loadWikiData's seed rows are.
+func documentsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ingestDocumentReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := ingestDocument(r.Context(), req)
+	if err != nil {
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// documentHandler implements DELETE /documents/{id}, removing every Wiki
+// row chunked from the given parent document id.
+func documentHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "only DELETE allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/documents/")
+	if id == "" {
+		http.Error(w, "missing document id", http.StatusBadRequest)
+		return
+	}
+
+	result := db.DB.ExecRequest(
+		r.Context(),
+		`mutation DeleteWiki($parentDocID: String!) {
+            delete_Wiki(filter: {parent_doc_id: {_eq: $parentDocID}}) { _docID }
+        }`,
+		client.WithVariables(map[string]interface{}{
+			"parentDocID": id,
+		}),
+	)
+	if len(result.GQL.Errors) > 0 {
+		http.Error(w, "internal error: "+result.GQL.Errors[0].Error(), http.StatusInternalServerError)
+		return
+	}
+	removeDeletedWikiRows(result.GQL.Data)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// removeDeletedWikiRows drops the docID(s) found in a delete_Wiki mutation's
+// GQL data from bm25Index, so deleted rows stop polluting keyword ranking.
+func removeDeletedWikiRows(gqlData interface{}) {
+	data, ok := gqlData.(map[string]interface{})
+	if !ok {
+		return
+	}
+	rows, ok := data["delete_Wiki"].([]interface{})
+	if !ok {
+		return
+	}
+	for _, rowAny := range rows {
+		row, ok := rowAny.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if docID, ok := row["_docID"].(string); ok {
+			bm25Index.Remove(docID)
+		}
+	}
+}
+
+func ingestDocument(ctx context.Context, req ingestDocumentReq) (*ingestDocumentResp, error) {
+	if req.Format == "json" {
+		return ingestJSONArticles(ctx, req)
+	}
+
+	text, err := loadDocumentText(req)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := chunker.DefaultOptions
+	if req.ChunkStrategy != "" {
+		opts.Strategy = chunker.Strategy(req.ChunkStrategy)
+	}
+	if req.ChunkSize > 0 {
+		opts.Size = req.ChunkSize
+	}
+	if req.ChunkOverlap > 0 {
+		opts.Overlap = req.ChunkOverlap
+	}
+	chunks := chunker.Split(text, opts)
+	if len(chunks) == 0 {
+		return nil, fmt.Errorf("document produced no chunks")
+	}
+
+	parentDocID := fmt.Sprintf("%s-%d", sanitizeID(req.Source), time.Now().UnixNano())
+	for i, c := range chunks {
+		if err := createWikiRow(ctx, "search_document: "+c, req.Category, req.Source, i, parentDocID); err != nil {
+			return nil, err
+		}
+	}
+	return &ingestDocumentResp{ParentDocID: parentDocID, ChunkCount: len(chunks)}, nil
+}
+
+func ingestJSONArticles(ctx context.Context, req ingestDocumentReq) (*ingestDocumentResp, error) {
+	var articles []struct {
+		Text     string `json:"text"`
+		Category string `json:"category"`
+	}
+	if err := json.Unmarshal([]byte(req.Content), &articles); err != nil {
+		return nil, fmt.Errorf("decoding json documents: %w", err)
+	}
+
+	parentDocID := fmt.Sprintf("%s-%d", sanitizeID(req.Source), time.Now().UnixNano())
+	for i, a := range articles {
+		content := "search_document: " + a.Text
+		if err := createWikiRow(ctx, content, a.Category, req.Source, i, parentDocID); err != nil {
+			return nil, err
+		}
+	}
+	return &ingestDocumentResp{ParentDocID: parentDocID, ChunkCount: len(articles)}, nil
+}
+
+// createWikiRow inserts one Wiki row. text_v is left for the schema's
+// @embedding directive to compute, same as loadWikiData's seed rows.
+func createWikiRow(ctx context.Context, content, category, source string, chunkIndex int, parentDocID string) error {
+	input := map[string]interface{}{
+		"text":          content,
+		"category":      category,
+		"source":        source,
+		"chunk_index":   chunkIndex,
+		"parent_doc_id": parentDocID,
+	}
+
+	result := db.DB.ExecRequest(
+		ctx,
+		`mutation CreateWiki($input: [WikiMutationInputArg!]!) {
+            create_Wiki(input: $input) { _docID }
+        }`,
+		client.WithVariables(map[string]interface{}{
+			"input": input,
+		}),
+	)
+	if len(result.GQL.Errors) > 0 {
+		return result.GQL.Errors[0]
+	}
+	indexCreatedWikiRows(result.GQL.Data, content, category)
+	return nil
+}
+
+func sanitizeID(s string) string {
+	if s == "" {
+		return "doc"
+	}
+	return regexp.MustCompile(`[^a-zA-Z0-9_.-]+`).ReplaceAllString(s, "_")
+}
+
+var htmlTagRe = regexp.MustCompile(`(?s)<[^>]*>`)
+
+// loadDocumentText converts req.Content into plain text according to
+// req.Format.
+func loadDocumentText(req ingestDocumentReq) (string, error) {
+	switch req.Format {
+	case "text", "markdown", "":
+		return req.Content, nil
+	case "html":
+		return strings.TrimSpace(htmlTagRe.ReplaceAllString(req.Content, " ")), nil
+	case "pdf":
+		return pdfToText(req.Content)
+	default:
+		return "", fmt.Errorf("unsupported document format %q", req.Format)
+	}
+}
+
+// pdfToText extracts plain text from a base64-encoded PDF. It understands
+// only the handful of PDF text-showing operators ("Tj"/"TJ" inside BT/ET
+// blocks) that cover most simple, non-scanned PDFs - good enough for
+// ingesting plain text documents without pulling in a full PDF renderer.
+func pdfToText(base64Content string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(base64Content)
+	if err != nil {
+		return "", fmt.Errorf("decoding pdf content: %w", err)
+	}
+
+	var sb strings.Builder
+	for _, tok := range pdfTextOperatorRe.FindAllStringSubmatch(string(raw), -1) {
+		switch {
+		case tok[1] != "":
+			sb.WriteString(tok[1])
+			sb.WriteString(" ")
+		case tok[2] != "":
+			for _, s := range pdfStringRe.FindAllStringSubmatch(tok[2], -1) {
+				sb.WriteString(s[1])
+			}
+			sb.WriteString(" ")
+		}
+	}
+	if sb.Len() == 0 {
+		return "", fmt.Errorf("no extractable text found in pdf")
+	}
+	return sb.String(), nil
+}
+
+// pdfTextOperatorRe matches a plain "(...) Tj" string-show or a kerned
+// "[(...) -250 (...)] TJ" array-show; capture group 1 holds the former's
+// text, group 2 the latter's raw array body (parsed further by
+// pdfStringRe).
+var pdfTextOperatorRe = regexp.MustCompile(`\(((?:[^()\\]|\\.)*)\)\s*Tj|\[((?:[^\]]|\\.)*)\]\s*TJ`)
+
+var pdfStringRe = regexp.MustCompile(`\(((?:[^()\\]|\\.)*)\)`)
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"html/template"
 	"io"
 	"log"
@@ -23,12 +24,24 @@ const (
 	schemaDef      = `type Wiki {
         text: String
         category: String
+        source: String
+        chunk_index: Int
+        parent_doc_id: String
         text_v: [Float32!] @embedding(fields: ["text"], provider: "ollama", model: "nomic-embed-text")
+    }
+
+    type ChatMessage {
+        session_id: String
+        role: String
+        content: String
+        created_at: String
+        content_v: [Float32!] @embedding(fields: ["content"], provider: "ollama", model: "nomic-embed-text")
     }`
 )
 
 var (
 	db              *node.Node
+	registry        *Registry
 	once            sync.Once
 	initErr         error
 	systemPromptTpl = template.Must(template.New("system_prompt").Parse(`
@@ -72,10 +85,18 @@ func initDefraNode() (*node.Node, error) {
 	return n, nil
 }
 
+// loadWikiData seeds the knowledge base from wiki.jsonl, if present. It is
+// purely an optional convenience for local/demo use; the knowledge base can
+// equally well grow from an empty start via POST /documents, so a missing
+// file is not an error.
 func loadWikiData(n *node.Node) error {
 	ctx := context.Background()
 
 	f, err := os.Open("wiki.jsonl")
+	if os.IsNotExist(err) {
+		log.Println("wiki.jsonl not found, starting with an empty knowledge base")
+		return nil
+	}
 	if err != nil {
 		return err
 	}
@@ -107,6 +128,7 @@ func loadWikiData(n *node.Node) error {
 				"input": map[string]interface{}{
 					"text":     content,
 					"category": article.Category,
+					"source":   "wiki.jsonl",
 				},
 			}),
 		)
@@ -129,13 +151,40 @@ func setupKnowledgeBase() error {
 		return err
 	}
 
+	if err := buildBM25Index(context.Background(), n); err != nil {
+		return err
+	}
+
+	reg, err := loadRegistry("models.yaml")
+	if err != nil {
+		return err
+	}
+
 	db = n
+	registry = reg
 	return nil
 }
 
 type askReq struct {
-	Question string `json:"question"`
+	Question      string   `json:"question"`
+	Model         string   `json:"model,omitempty"`
+	TopK          int      `json:"top_k,omitempty"`
+	Lambda        float64  `json:"lambda,omitempty"`
+	FusionK       int      `json:"fusion_k,omitempty"`
+	Categories    []string `json:"categories,omitempty"`
+	MinSimilarity float64  `json:"min_similarity,omitempty"`
 }
+
+func (r askReq) retrievalOptions() retrievalOptions {
+	return retrievalOptions{
+		TopK:          r.TopK,
+		Lambda:        r.Lambda,
+		FusionK:       r.FusionK,
+		Categories:    r.Categories,
+		MinSimilarity: r.MinSimilarity,
+	}
+}
+
 type askResp struct {
 	Answer string `json:"answer"`
 }
@@ -150,6 +199,11 @@ func main() {
 	log.Println("Knowledge base initialized and HTTP API server is running at :8080")
 
 	http.HandleFunc("/ask", askHandler)
+	http.HandleFunc("/ask/stream", askStreamHandler)
+	registerOpenAICompatRoutes()
+	registerIngestionRoutes()
+	registerSessionRoutes()
+	http.HandleFunc("/categories", categoriesHandler)
 	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("ok"))
@@ -169,12 +223,16 @@ func askHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "only POST allowed", http.StatusMethodNotAllowed)
 		return
 	}
+	if r.URL.Query().Get("stream") == "true" {
+		askStreamHandler(w, r)
+		return
+	}
 	var req askReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Question) == "" {
 		http.Error(w, "invalid payload", http.StatusBadRequest)
 		return
 	}
-	answer, err := handleRAGRequest(r.Context(), req.Question)
+	answer, err := handleRAGRequest(r.Context(), req.Question, req.Model, req.retrievalOptions())
 	if err != nil {
 		log.Printf("Pipeline error: %v", err)
 		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
@@ -183,71 +241,138 @@ func askHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(askResp{Answer: answer})
 }
 
-func handleRAGRequest(ctx context.Context, question string) (string, error) {
-	// 1. Build query embedding
-	openAIClient := openai.NewClientWithConfig(openai.ClientConfig{
-		BaseURL:    ollamaBaseURL,
-		HTTPClient: http.DefaultClient,
-	})
-	queryWithPrefix := "search_query: " + question
-	embeddingResp, err := openAIClient.CreateEmbeddings(ctx, openai.EmbeddingRequest{
-		Input: []string{queryWithPrefix},
-		Model: embeddingModel,
-	})
+// askStreamHandler serves the same question/answer pipeline as askHandler but
+// progressively pushes generated tokens to the client over Server-Sent Events
+// instead of waiting for the full completion.
+func askStreamHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "OPTIONS" {
+		w.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "*")
+		return
+	}
+	if r.Method != "POST" {
+		http.Error(w, "only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req askReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Question) == "" {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	contexts, err := retrieveContexts(r.Context(), req.Question, "", req.retrievalOptions())
 	if err != nil {
-		return "", err
+		log.Printf("Pipeline error: %v", err)
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
-	// 2. Retrieve top relevant docs
-	queryResult := db.DB.ExecRequest(
-		ctx,
-		`query Search($queryVector: [Float32!]!) {
-            Wiki(
-                filter: {_alias: {sim: {_gt: 0.63}}},
-                limit: 2,
-                order: {_alias: {sim: DESC}}
-            ) {
-                text
-                sim: _similarity(text_v: {vector: $queryVector})
-            }
-        }`,
-		client.WithVariables(map[string]interface{}{
-			"queryVector": embeddingResp.Data[0].Embedding,
-		}),
-	)
-	contexts := []string{}
-	if found, ok := queryResult.GQL.Data.(map[string]interface{})["Wiki"].([]interface{}); ok {
-		for _, resAny := range found {
-			res, ok := resAny.(map[string]interface{})
-			if !ok {
-				continue
-			}
-			content := strings.TrimPrefix(res["text"].(string), "search_document: ")
-			contexts = append(contexts, content)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	err = askLLMStream(r.Context(), contexts, req.Question, req.Model, func(token string) {
+		if token == "" {
+			return
 		}
+		chunk, err := json.Marshal(askResp{Answer: token})
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "data: %s\n\n", chunk)
+		flusher.Flush()
+	})
+	if err != nil {
+		log.Printf("Stream error: %v", err)
+		fmt.Fprintf(w, "data: {\"error\": %q}\n\n", err.Error())
+		flusher.Flush()
 	}
-	// 3. Ask LLM with retrieved context
-	answer := askLLM(ctx, contexts, question)
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+func handleRAGRequest(ctx context.Context, question string, modelName string, opts retrievalOptions) (string, error) {
+	contexts, err := retrieveContexts(ctx, question, "", opts)
+	if err != nil {
+		return "", err
+	}
+	answer := askLLM(ctx, contexts, question, modelName)
 	return answer, nil
 }
 
-func askLLM(ctx context.Context, contexts []string, question string) string {
-	openAIClient := openai.NewClientWithConfig(openai.ClientConfig{
-		BaseURL:    ollamaBaseURL,
-		HTTPClient: http.DefaultClient,
-	})
+// retrieveContexts fetches the contexts to ground an answer in, via the
+// hybrid BM25 + vector retriever.
+func retrieveContexts(ctx context.Context, question string, embeddingModelName string, opts retrievalOptions) ([]string, error) {
+	return hybridRetrieve(ctx, question, embeddingModelName, opts)
+}
+
+// renderSystemPrompt executes the prompt template - the model's configured
+// prompt_template when set, else the default systemPromptTpl - against
+// contexts and returns the resulting system message content. promptTemplate
+// is parsed with the same data (the context slice) so it can range over it
+// exactly like the default template does.
+func renderSystemPrompt(contexts []string, promptTemplate string) string {
+	tpl := systemPromptTpl
+	if promptTemplate != "" {
+		t, err := template.New("model_prompt").Parse(promptTemplate)
+		if err != nil {
+			log.Printf("invalid prompt_template, falling back to default: %v", err)
+		} else {
+			tpl = t
+		}
+	}
 	sb := &strings.Builder{}
-	_ = systemPromptTpl.Execute(sb, contexts)
-	messages := []openai.ChatCompletionMessage{
-		{Role: openai.ChatMessageRoleSystem, Content: sb.String()},
+	_ = tpl.Execute(sb, contexts)
+	return sb.String()
+}
+
+// buildMessages assembles the system prompt and question into a chat
+// history.
+func buildMessages(contexts []string, question string, promptTemplate string) []openai.ChatCompletionMessage {
+	return []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: renderSystemPrompt(contexts, promptTemplate)},
 		{Role: openai.ChatMessageRoleUser, Content: "Question: " + question},
 	}
-	res, err := openAIClient.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
-		Model:    llmModel,
-		Messages: messages,
-	})
+}
+
+func askLLM(ctx context.Context, contexts []string, question string, modelName string) string {
+	chatBackend, err := registry.Chat(modelName)
+	if err != nil {
+		log.Printf("LLM error: %v", err)
+		return "Sorry, I couldn't generate an answer."
+	}
+	answer, err := chatBackend.Chat(ctx, buildMessages(contexts, question, registry.PromptTemplate(modelName)), 0)
 	if err != nil {
 		log.Printf("LLM error: %v", err)
 		return "Sorry, I couldn't generate an answer."
 	}
-	return strings.TrimSpace(res.Choices[0].Message.Content)
+	return strings.TrimSpace(answer)
+}
+
+// askLLMStream asks the LLM for an answer and invokes onToken for each
+// incremental chunk of content as it arrives from the provider. Backends
+// that can't stream fall back to delivering the full answer as one token.
+func askLLMStream(ctx context.Context, contexts []string, question string, modelName string, onToken func(string)) error {
+	chatBackend, err := registry.Chat(modelName)
+	if err != nil {
+		return err
+	}
+	messages := buildMessages(contexts, question, registry.PromptTemplate(modelName))
+	streamBackend, ok := chatBackend.(StreamingBackend)
+	if !ok {
+		answer, err := chatBackend.Chat(ctx, messages, 0)
+		if err != nil {
+			return err
+		}
+		onToken(answer)
+		return nil
+	}
+	return streamBackend.ChatStream(ctx, messages, 0, onToken)
 }
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// registerOpenAICompatRoutes wires up an OpenAI-compatible REST surface so
+// this RAG pipeline can be dropped into existing OpenAI SDKs and chat UIs.
+func registerOpenAICompatRoutes() {
+	http.HandleFunc("/v1/chat/completions", chatCompletionsHandler)
+	http.HandleFunc("/v1/completions", completionsHandler)
+	http.HandleFunc("/v1/embeddings", embeddingsHandler)
+	http.HandleFunc("/v1/models", modelsHandler)
+}
+
+func lastUserMessage(messages []openai.ChatCompletionMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == openai.ChatMessageRoleUser {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
+
+// buildChatCompletionMessages prepends a system message carrying the RAG
+// context ahead of the caller's full conversation, so multi-turn history in
+// reqMessages is preserved instead of being discarded down to the last user
+// turn.
+func buildChatCompletionMessages(reqMessages []openai.ChatCompletionMessage, contexts []string, promptTemplate string) []openai.ChatCompletionMessage {
+	messages := make([]openai.ChatCompletionMessage, 0, len(reqMessages)+1)
+	messages = append(messages, openai.ChatCompletionMessage{
+		Role:    openai.ChatMessageRoleSystem,
+		Content: renderSystemPrompt(contexts, promptTemplate),
+	})
+	return append(messages, reqMessages...)
+}
+
+// chatCompletionsHandler implements POST /v1/chat/completions. It retrieves
+// contexts from DefraDB using the last user message, injects them as a
+// leading system message, and forwards the full conversation to the
+// configured backend.
+func chatCompletionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, "only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req openai.ChatCompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	question := lastUserMessage(req.Messages)
+	contexts, err := retrieveContexts(r.Context(), question, "", defaultRetrievalOptions)
+	if err != nil {
+		log.Printf("Pipeline error: %v", err)
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	chatBackend, err := registry.Chat(req.Model)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	messages := buildChatCompletionMessages(req.Messages, contexts, registry.PromptTemplate(req.Model))
+	id := fmt.Sprintf("chatcmpl-%d", time.Now().UnixNano())
+	created := time.Now().Unix()
+
+	if req.Stream {
+		streamChatCompletion(w, r, chatBackend, messages, req, id, created)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	answer, err := chatBackend.Chat(r.Context(), messages, req.Temperature)
+	if err != nil {
+		log.Printf("LLM error: %v", err)
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+		ID:      id,
+		Object:  "chat.completion",
+		Created: created,
+		Model:   req.Model,
+		Choices: []openai.ChatCompletionChoice{
+			{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: answer}},
+		},
+	})
+}
+
+// streamChatCompletion serves req as Server-Sent Events of
+// "chat.completion.chunk" objects, the shape strict OpenAI SDK clients
+// expect from a streaming /v1/chat/completions call.
+func streamChatCompletion(w http.ResponseWriter, r *http.Request, chatBackend Backend, messages []openai.ChatCompletionMessage, req openai.ChatCompletionRequest, id string, created int64) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	sendChunk := func(content string, finishReason openai.FinishReason) {
+		chunk, err := json.Marshal(openai.ChatCompletionStreamResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Created: created,
+			Model:   req.Model,
+			Choices: []openai.ChatCompletionStreamChoice{
+				{Delta: openai.ChatCompletionStreamChoiceDelta{Content: content}, FinishReason: finishReason},
+			},
+		})
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "data: %s\n\n", chunk)
+		flusher.Flush()
+	}
+
+	var err error
+	if streamBackend, ok := chatBackend.(StreamingBackend); ok {
+		err = streamBackend.ChatStream(r.Context(), messages, req.Temperature, func(token string) {
+			if token != "" {
+				sendChunk(token, "")
+			}
+		})
+	} else {
+		var answer string
+		answer, err = chatBackend.Chat(r.Context(), messages, req.Temperature)
+		if err == nil {
+			sendChunk(answer, "")
+		}
+	}
+	if err != nil {
+		log.Printf("LLM error: %v", err)
+	} else {
+		sendChunk("", openai.FinishReasonStop)
+	}
+	fmt.Fprint(w, "data: [DONE]\n\n")
+	flusher.Flush()
+}
+
+// completionsHandler implements the legacy POST /v1/completions, forwarding
+// the prompt straight through to the configured LLM backend without RAG.
+func completionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req openai.CompletionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	prompt, err := promptText(req.Prompt)
+	if err != nil {
+		http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	chatBackend, err := registry.Chat(req.Model)
+	if err != nil {
+		http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	answer, err := chatBackend.Chat(r.Context(), []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleUser, Content: prompt},
+	}, req.Temperature)
+	if err != nil {
+		log.Printf("LLM error: %v", err)
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(openai.CompletionResponse{
+		Model: req.Model,
+		Choices: []openai.CompletionChoice{
+			{Text: answer},
+		},
+	})
+}
+
+// promptText normalizes CompletionRequest.Prompt, which the OpenAI schema
+// types as any (a string, an array of strings, or absent), into plain text.
+func promptText(prompt interface{}) (string, error) {
+	switch p := prompt.(type) {
+	case string:
+		if p == "" {
+			return "", fmt.Errorf("prompt is required")
+		}
+		return p, nil
+	case []interface{}:
+		parts := make([]string, 0, len(p))
+		for _, v := range p {
+			s, ok := v.(string)
+			if !ok {
+				return "", fmt.Errorf("prompt array must contain only strings")
+			}
+			parts = append(parts, s)
+		}
+		if len(parts) == 0 {
+			return "", fmt.Errorf("prompt is required")
+		}
+		return strings.Join(parts, "\n"), nil
+	case nil:
+		return "", fmt.Errorf("prompt is required")
+	default:
+		return "", fmt.Errorf("unsupported prompt type %T", prompt)
+	}
+}
+
+// embeddingInputTexts normalizes EmbeddingRequest.Input, which the OpenAI
+// schema types as any (a bare string, or an array of strings, the same
+// shape promptText handles for /v1/completions), into a slice of texts.
+func embeddingInputTexts(input interface{}) ([]string, error) {
+	switch v := input.(type) {
+	case string:
+		if v == "" {
+			return nil, fmt.Errorf("input is required")
+		}
+		return []string{v}, nil
+	case []interface{}:
+		texts := make([]string, 0, len(v))
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return nil, fmt.Errorf("input array must contain only strings")
+			}
+			texts = append(texts, s)
+		}
+		if len(texts) == 0 {
+			return nil, fmt.Errorf("input is required")
+		}
+		return texts, nil
+	case nil:
+		return nil, fmt.Errorf("input is required")
+	default:
+		return nil, fmt.Errorf("unsupported input type %T", input)
+	}
+}
+
+// embeddingsHandler implements POST /v1/embeddings, proxying straight to the
+// embedding model.
+func embeddingsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Model string      `json:"model"`
+		Input interface{} `json:"input"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+	texts, err := embeddingInputTexts(req.Input)
+	if err != nil {
+		http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	embedBackend, err := registry.Embedding(req.Model)
+	if err != nil {
+		http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	embeddings, err := embedBackend.Embed(r.Context(), texts)
+	if err != nil {
+		log.Printf("Embedding error: %v", err)
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data := make([]openai.Embedding, len(embeddings))
+	for i, e := range embeddings {
+		data[i] = openai.Embedding{Index: i, Embedding: e}
+	}
+	json.NewEncoder(w).Encode(openai.EmbeddingResponse{Model: openai.EmbeddingModel(req.Model), Data: data})
+}
+
+// modelsHandler implements GET /v1/models, listing the models this gateway
+// can serve.
+func modelsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var models []openai.Model
+	for _, name := range registry.ChatModelNames() {
+		models = append(models, openai.Model{ID: name, Object: "model"})
+	}
+	for _, name := range registry.EmbeddingModelNames() {
+		models = append(models, openai.Model{ID: name, Object: "model"})
+	}
+	json.NewEncoder(w).Encode(openai.ModelsList{Models: models})
+}
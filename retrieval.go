@@ -0,0 +1,517 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/sourcenetwork/defradb/client"
+	"github.com/sourcenetwork/defradb/node"
+)
+
+// retrievalOptions tunes the hybrid retriever. TopK is how many contexts
+// are finally returned, Lambda trades relevance against diversity in MMR,
+// and FusionK is the RRF constant (and the size of the candidate pool
+// pulled from each ranker before fusion). Categories narrows both rankers'
+// candidate pools to a facet of the knowledge base before fusion and
+// re-ranking run; MinSimilarity filters only the vector pass, so keyword
+// hits below it can still be fused in.
+type retrievalOptions struct {
+	TopK          int
+	Lambda        float64
+	FusionK       int
+	Categories    []string
+	MinSimilarity float64
+}
+
+var defaultRetrievalOptions = retrievalOptions{TopK: 2, Lambda: 0.5, FusionK: 60}
+
+func (o retrievalOptions) withDefaults() retrievalOptions {
+	if o.TopK <= 0 {
+		o.TopK = defaultRetrievalOptions.TopK
+	}
+	if o.Lambda <= 0 {
+		o.Lambda = defaultRetrievalOptions.Lambda
+	}
+	if o.FusionK <= 0 {
+		o.FusionK = defaultRetrievalOptions.FusionK
+	}
+	return o
+}
+
+// bm25Index is a small in-process inverted index over Wiki rows, kept up
+// to date as documents are ingested, so the keyword pass doesn't require
+// an external search service.
+var bm25Index = newBM25Index()
+
+type bm25Doc struct {
+	text     string
+	category string
+	terms    map[string]int
+	length   int
+}
+
+// BM25Index scores documents against a query with Okapi BM25.
+type BM25Index struct {
+	mu       sync.RWMutex
+	docs     map[string]*bm25Doc
+	df       map[string]int
+	totalLen int
+}
+
+func newBM25Index() *BM25Index {
+	return &BM25Index{docs: map[string]*bm25Doc{}, df: map[string]int{}}
+}
+
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// Add indexes or re-indexes docID with the given text and category.
+func (idx *BM25Index) Add(docID, text, category string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if old, ok := idx.docs[docID]; ok {
+		for t := range old.terms {
+			idx.df[t]--
+		}
+		idx.totalLen -= old.length
+	}
+
+	terms := map[string]int{}
+	tokens := tokenize(text)
+	for _, t := range tokens {
+		terms[t]++
+	}
+	d := &bm25Doc{text: text, category: category, terms: terms, length: len(tokens)}
+	idx.docs[docID] = d
+	for t := range terms {
+		idx.df[t]++
+	}
+	idx.totalLen += d.length
+}
+
+// Remove drops docID from the index, if present, backing out its terms
+// from df and totalLen so later searches don't keep scoring against a
+// document that no longer exists.
+func (idx *BM25Index) Remove(docID string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	old, ok := idx.docs[docID]
+	if !ok {
+		return
+	}
+	for t := range old.terms {
+		idx.df[t]--
+	}
+	idx.totalLen -= old.length
+	delete(idx.docs, docID)
+}
+
+// Search ranks indexed documents against query and returns up to topN
+// docIDs, best match first. When categories is non-empty, only documents
+// in one of those categories are considered.
+func (idx *BM25Index) Search(query string, topN int, categories []string) []string {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	n := len(idx.docs)
+	if n == 0 {
+		return nil
+	}
+	avgLen := float64(idx.totalLen) / float64(n)
+	const k1, b = 1.5, 0.75
+
+	scores := map[string]float64{}
+	for _, qt := range tokenize(query) {
+		df := idx.df[qt]
+		if df <= 0 {
+			continue
+		}
+		idf := math.Log(1 + (float64(n)-float64(df)+0.5)/(float64(df)+0.5))
+		for docID, d := range idx.docs {
+			if len(categories) > 0 && !containsString(categories, d.category) {
+				continue
+			}
+			tf := float64(d.terms[qt])
+			if tf == 0 {
+				continue
+			}
+			denom := tf + k1*(1-b+b*float64(d.length)/avgLen)
+			scores[docID] += idf * (tf * (k1 + 1) / denom)
+		}
+	}
+
+	type scoredID struct {
+		docID string
+		score float64
+	}
+	ranked := make([]scoredID, 0, len(scores))
+	for docID, s := range scores {
+		ranked = append(ranked, scoredID{docID, s})
+	}
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].score > ranked[j].score })
+	if len(ranked) > topN {
+		ranked = ranked[:topN]
+	}
+
+	out := make([]string, len(ranked))
+	for i, r := range ranked {
+		out[i] = r.docID
+	}
+	return out
+}
+
+// buildBM25Index loads every existing Wiki row into bm25Index, so keyword
+// search works from the first query onward.
+func buildBM25Index(ctx context.Context, n *node.Node) error {
+	result := n.DB.ExecRequest(
+		ctx,
+		`query { Wiki { _docID text category } }`,
+	)
+	if len(result.GQL.Errors) > 0 {
+		return result.GQL.Errors[0]
+	}
+	found, ok := result.GQL.Data.(map[string]interface{})["Wiki"].([]interface{})
+	if !ok {
+		return nil
+	}
+	for _, resAny := range found {
+		res, ok := resAny.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		docID, _ := res["_docID"].(string)
+		text, _ := res["text"].(string)
+		category, _ := res["category"].(string)
+		if docID == "" {
+			continue
+		}
+		bm25Index.Add(docID, text, category)
+	}
+	return nil
+}
+
+// indexCreatedWikiRows adds the docID(s) found in a create_Wiki mutation's
+// GQL data to bm25Index so keyword search picks them up immediately.
+func indexCreatedWikiRows(gqlData interface{}, text, category string) {
+	data, ok := gqlData.(map[string]interface{})
+	if !ok {
+		return
+	}
+	rows, ok := data["create_Wiki"].([]interface{})
+	if !ok {
+		return
+	}
+	for _, rowAny := range rows {
+		row, ok := rowAny.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if docID, ok := row["_docID"].(string); ok {
+			bm25Index.Add(docID, text, category)
+		}
+	}
+}
+
+// categoriesHandler implements GET /categories, aggregating the distinct
+// category values present in the knowledge base so clients can build
+// faceted queries without knowing the schema.
+func categoriesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	result := db.DB.ExecRequest(r.Context(), `query { Wiki { category } }`)
+	if len(result.GQL.Errors) > 0 {
+		http.Error(w, "internal error: "+result.GQL.Errors[0].Error(), http.StatusInternalServerError)
+		return
+	}
+
+	seen := map[string]bool{}
+	var categories []string
+	if found, ok := result.GQL.Data.(map[string]interface{})["Wiki"].([]interface{}); ok {
+		for _, resAny := range found {
+			res, ok := resAny.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			category, _ := res["category"].(string)
+			if category == "" || seen[category] {
+				continue
+			}
+			seen[category] = true
+			categories = append(categories, category)
+		}
+	}
+	sort.Strings(categories)
+	json.NewEncoder(w).Encode(map[string][]string{"categories": categories})
+}
+
+func containsString(haystack []string, needle string) bool {
+	for _, s := range haystack {
+		if s == needle {
+			return true
+		}
+	}
+	return false
+}
+
+// candidateDoc is a fused retrieval candidate carrying everything MMR
+// needs: its text and embedding vector.
+type candidateDoc struct {
+	docID  string
+	text   string
+	vector []float32
+}
+
+// hybridRetrieve runs a BM25 keyword pass and a vector similarity pass in
+// parallel, fuses them with Reciprocal Rank Fusion, then re-ranks the
+// fused pool with Maximal Marginal Relevance so the final contexts are
+// both relevant and non-redundant.
+func hybridRetrieve(ctx context.Context, question string, embeddingModelName string, opts retrievalOptions) ([]string, error) {
+	opts = opts.withDefaults()
+
+	embedBackend, err := registry.Embedding(embeddingModelName)
+	if err != nil {
+		return nil, err
+	}
+	queryEmbeddings, err := embedBackend.Embed(ctx, []string{"search_query: " + question})
+	if err != nil {
+		return nil, err
+	}
+	queryVector := queryEmbeddings[0]
+
+	var vectorRanked []string
+	var keywordRanked []string
+	var wg sync.WaitGroup
+	var vecErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		vectorRanked, vecErr = vectorSearch(ctx, queryVector, opts.FusionK, opts.Categories, opts.MinSimilarity)
+	}()
+	go func() {
+		defer wg.Done()
+		keywordRanked = bm25Index.Search(question, opts.FusionK, opts.Categories)
+	}()
+	wg.Wait()
+	if vecErr != nil {
+		return nil, vecErr
+	}
+
+	fused := reciprocalRankFusion(opts.FusionK, vectorRanked, keywordRanked)
+	if len(fused) > opts.FusionK {
+		fused = fused[:opts.FusionK]
+	}
+	if len(fused) == 0 {
+		return []string{}, nil
+	}
+
+	candidates, err := fetchCandidates(ctx, fused, opts.Categories)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := maximalMarginalRelevance(queryVector, candidates, opts.TopK, opts.Lambda)
+	contexts := make([]string, len(selected))
+	for i, c := range selected {
+		contexts[i] = strings.TrimPrefix(c.text, "search_document: ")
+	}
+	return contexts, nil
+}
+
+// vectorSearch returns up to topN Wiki docIDs ordered by cosine
+// similarity to queryVector, filtered to categories (when given) and to a
+// minimum similarity. It no longer applies the old hard 0.63 threshold so
+// keyword-heavy queries with modest vector scores still surface.
+func vectorSearch(ctx context.Context, queryVector []float32, topN int, categories []string, minSimilarity float64) ([]string, error) {
+	filter := map[string]interface{}{
+		"_alias": map[string]interface{}{
+			"sim": map[string]interface{}{"_gt": minSimilarity},
+		},
+	}
+	if len(categories) > 0 {
+		filter["category"] = map[string]interface{}{"_in": categories}
+	}
+
+	queryResult := db.DB.ExecRequest(
+		ctx,
+		`query Search($queryVector: [Float32!]!, $limit: Int!, $filter: WikiFilterArg) {
+            Wiki(
+                filter: $filter,
+                limit: $limit,
+                order: {_alias: {sim: DESC}}
+            ) {
+                _docID
+                sim: _similarity(text_v: {vector: $queryVector})
+            }
+        }`,
+		client.WithVariables(map[string]interface{}{
+			"queryVector": queryVector,
+			"limit":       topN,
+			"filter":      filter,
+		}),
+	)
+	if len(queryResult.GQL.Errors) > 0 {
+		return nil, queryResult.GQL.Errors[0]
+	}
+	found, ok := queryResult.GQL.Data.(map[string]interface{})["Wiki"].([]interface{})
+	if !ok {
+		return nil, nil
+	}
+	docIDs := make([]string, 0, len(found))
+	for _, resAny := range found {
+		res, ok := resAny.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if docID, ok := res["_docID"].(string); ok {
+			docIDs = append(docIDs, docID)
+		}
+	}
+	return docIDs, nil
+}
+
+// fetchCandidates loads text and embedding vectors for a fixed set of
+// docIDs in a single query, optionally narrowed to a set of categories.
+func fetchCandidates(ctx context.Context, docIDs []string, categories []string) ([]candidateDoc, error) {
+	filter := map[string]interface{}{
+		"_docID": map[string]interface{}{"_in": docIDs},
+	}
+	if len(categories) > 0 {
+		filter["category"] = map[string]interface{}{"_in": categories}
+	}
+
+	result := db.DB.ExecRequest(
+		ctx,
+		`query Candidates($filter: WikiFilterArg) {
+            Wiki(filter: $filter) {
+                _docID
+                text
+                text_v
+            }
+        }`,
+		client.WithVariables(map[string]interface{}{
+			"filter": filter,
+		}),
+	)
+	if len(result.GQL.Errors) > 0 {
+		return nil, result.GQL.Errors[0]
+	}
+	found, ok := result.GQL.Data.(map[string]interface{})["Wiki"].([]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	byID := map[string]candidateDoc{}
+	for _, resAny := range found {
+		res, ok := resAny.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		docID, _ := res["_docID"].(string)
+		text, _ := res["text"].(string)
+		c := candidateDoc{docID: docID, text: text}
+		if rawVec, ok := res["text_v"].([]interface{}); ok {
+			vec := make([]float32, len(rawVec))
+			for i, v := range rawVec {
+				if f, ok := v.(float64); ok {
+					vec[i] = float32(f)
+				}
+			}
+			c.vector = vec
+		}
+		byID[docID] = c
+	}
+
+	// Preserve fusion order so ties in MMR's first pick favour the
+	// higher-ranked candidate.
+	ordered := make([]candidateDoc, 0, len(docIDs))
+	for _, id := range docIDs {
+		if c, ok := byID[id]; ok {
+			ordered = append(ordered, c)
+		}
+	}
+	return ordered, nil
+}
+
+// reciprocalRankFusion merges ranked doc ID lists with RRF:
+// score(d) = sum 1/(k + rank_i(d)) across every ranker that contains d.
+// Returns doc IDs sorted by descending fused score.
+func reciprocalRankFusion(k int, rankedLists ...[]string) []string {
+	scores := map[string]float64{}
+	order := []string{}
+	for _, list := range rankedLists {
+		for i, docID := range list {
+			if _, seen := scores[docID]; !seen {
+				order = append(order, docID)
+			}
+			scores[docID] += 1.0 / float64(k+i+1)
+		}
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] > scores[order[j]] })
+	return order
+}
+
+// maximalMarginalRelevance iteratively selects from candidates the doc
+// maximizing lambda*sim(d,q) - (1-lambda)*max_{s in selected} sim(d,s),
+// until k docs are chosen (or candidates run out).
+func maximalMarginalRelevance(queryVector []float32, candidates []candidateDoc, k int, lambda float64) []candidateDoc {
+	remaining := make([]candidateDoc, 0, len(candidates))
+	for _, c := range candidates {
+		if len(c.vector) > 0 {
+			remaining = append(remaining, c)
+		}
+	}
+
+	var selected []candidateDoc
+	for len(selected) < k && len(remaining) > 0 {
+		bestIdx := -1
+		bestScore := math.Inf(-1)
+		for i, cand := range remaining {
+			relevance := cosineSimilarity(queryVector, cand.vector)
+			diversityPenalty := 0.0
+			for j, s := range selected {
+				if sim := cosineSimilarity(cand.vector, s.vector); j == 0 || sim > diversityPenalty {
+					diversityPenalty = sim
+				}
+			}
+			score := lambda*relevance - (1-lambda)*diversityPenalty
+			if score > bestScore {
+				bestScore = score
+				bestIdx = i
+			}
+		}
+		selected = append(selected, remaining[bestIdx])
+		remaining = append(remaining[:bestIdx], remaining[bestIdx+1:]...)
+	}
+	return selected
+}
+
+func cosineSimilarity(a, b []float32) float64 {
+	if len(a) == 0 || len(b) == 0 || len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/sourcenetwork/defradb/client"
+)
+
+// historyTokenBudget caps the approximate number of words of conversation
+// history kept verbatim in the prompt. Once a session's history grows past
+// this, older turns are condensed into a running summary instead of being
+// dropped, so follow-up questions still resolve against earlier context.
+const historyTokenBudget = 1500
+
+// keepRecentTurns is how many of the most recent messages are always kept
+// verbatim when condensing history.
+const keepRecentTurns = 6
+
+// createdAtLayout formats timestamps with a fixed-width, zero-padded
+// fractional second, so created_at sorts the same lexically (as DefraDB's
+// order: {created_at: ASC} does) as it does chronologically. RFC3339Nano
+// trims trailing zeros, which breaks that for turns within the same second.
+const createdAtLayout = "2006-01-02T15:04:05.000000000Z07:00"
+
+// registerSessionRoutes wires up the multi-turn chat session API.
+func registerSessionRoutes() {
+	http.HandleFunc("/sessions", sessionsHandler)
+	http.HandleFunc("/sessions/", sessionMessagesHandler)
+}
+
+type createSessionResp struct {
+	SessionID string `json:"session_id"`
+}
+
+// sessionsHandler implements POST /sessions, minting a new session id that
+// subsequent turns are threaded under.
+func sessionsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	sessionID := fmt.Sprintf("sess-%d", time.Now().UnixNano())
+	json.NewEncoder(w).Encode(createSessionResp{SessionID: sessionID})
+}
+
+type sessionMessageReq struct {
+	Message string `json:"message"`
+	Model   string `json:"model,omitempty"`
+}
+
+type sessionMessageResp struct {
+	Answer string `json:"answer"`
+}
+
+// sessionMessagesHandler implements POST /sessions/{id}/messages: persist
+// the user's turn, retrieve KB contexts for it, build a prompt from prior
+// history plus those contexts, answer, and persist the assistant's turn.
+func sessionMessagesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionID, ok := parseSessionID(r.URL.Path)
+	if !ok {
+		http.Error(w, "missing session id", http.StatusBadRequest)
+		return
+	}
+
+	var req sessionMessageReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || strings.TrimSpace(req.Message) == "" {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+		return
+	}
+
+	answer, err := handleSessionTurn(r.Context(), sessionID, req.Message, req.Model)
+	if err != nil {
+		http.Error(w, "internal error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(sessionMessageResp{Answer: answer})
+}
+
+// parseSessionID extracts {id} from a /sessions/{id}/messages path.
+func parseSessionID(path string) (string, bool) {
+	trimmed := strings.TrimPrefix(path, "/sessions/")
+	trimmed = strings.TrimSuffix(trimmed, "/messages")
+	trimmed = strings.TrimSuffix(trimmed, "/")
+	if trimmed == "" || trimmed == path {
+		return "", false
+	}
+	return trimmed, true
+}
+
+// chatMessageRow is one persisted turn of a session's history.
+type chatMessageRow struct {
+	role    string
+	content string
+}
+
+// handleSessionTurn loads prior history, condenses it if it has grown too
+// large, retrieves KB contexts for the new message, asks the LLM, and
+// persists both the user's turn and the assistant's reply.
+func handleSessionTurn(ctx context.Context, sessionID, message, modelName string) (string, error) {
+	history, err := loadSessionHistory(ctx, sessionID)
+	if err != nil {
+		return "", err
+	}
+	history, err = condenseSessionHistory(ctx, history, modelName)
+	if err != nil {
+		return "", err
+	}
+
+	contexts, err := retrieveContexts(ctx, message, "", defaultRetrievalOptions)
+	if err != nil {
+		return "", err
+	}
+
+	if err := appendSessionMessage(ctx, sessionID, openai.ChatMessageRoleUser, message); err != nil {
+		return "", err
+	}
+
+	chatBackend, err := registry.Chat(modelName)
+	if err != nil {
+		return "", err
+	}
+	answer, err := chatBackend.Chat(ctx, buildSessionMessages(contexts, history, message), 0)
+	if err != nil {
+		return "", err
+	}
+	answer = strings.TrimSpace(answer)
+
+	if err := appendSessionMessage(ctx, sessionID, openai.ChatMessageRoleAssistant, answer); err != nil {
+		return "", err
+	}
+	return answer, nil
+}
+
+// buildSessionMessages assembles the system prompt (with KB contexts),
+// prior turns, and the new user message into one chat history.
+func buildSessionMessages(contexts []string, history []chatMessageRow, question string) []openai.ChatCompletionMessage {
+	sb := &strings.Builder{}
+	_ = systemPromptTpl.Execute(sb, contexts)
+	messages := []openai.ChatCompletionMessage{
+		{Role: openai.ChatMessageRoleSystem, Content: sb.String()},
+	}
+	for _, m := range history {
+		messages = append(messages, openai.ChatCompletionMessage{Role: m.role, Content: m.content})
+	}
+	messages = append(messages, openai.ChatCompletionMessage{Role: openai.ChatMessageRoleUser, Content: question})
+	return messages
+}
+
+// loadSessionHistory fetches every turn recorded for sessionID, oldest
+// first.
+func loadSessionHistory(ctx context.Context, sessionID string) ([]chatMessageRow, error) {
+	result := db.DB.ExecRequest(
+		ctx,
+		`query History($sessionID: String!) {
+            ChatMessage(filter: {session_id: {_eq: $sessionID}}, order: {created_at: ASC}) {
+                role
+                content
+            }
+        }`,
+		client.WithVariables(map[string]interface{}{
+			"sessionID": sessionID,
+		}),
+	)
+	if len(result.GQL.Errors) > 0 {
+		return nil, result.GQL.Errors[0]
+	}
+	found, ok := result.GQL.Data.(map[string]interface{})["ChatMessage"].([]interface{})
+	if !ok {
+		return nil, nil
+	}
+
+	rows := make([]chatMessageRow, 0, len(found))
+	for _, resAny := range found {
+		res, ok := resAny.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		role, _ := res["role"].(string)
+		content, _ := res["content"].(string)
+		rows = append(rows, chatMessageRow{role: role, content: content})
+	}
+	return rows, nil
+}
+
+// appendSessionMessage persists one turn. content_v is left for the
+// schema's @embedding directive to compute.
+func appendSessionMessage(ctx context.Context, sessionID, role, content string) error {
+	result := db.DB.ExecRequest(
+		ctx,
+		`mutation CreateChatMessage($input: [ChatMessageMutationInputArg!]!) {
+            create_ChatMessage(input: $input) { _docID }
+        }`,
+		client.WithVariables(map[string]interface{}{
+			"input": map[string]interface{}{
+				"session_id": sessionID,
+				"role":       role,
+				"content":    content,
+				"created_at": time.Now().UTC().Format(createdAtLayout),
+			},
+		}),
+	)
+	if len(result.GQL.Errors) > 0 {
+		return result.GQL.Errors[0]
+	}
+	return nil
+}
+
+// condenseSessionHistory collapses everything but the most recent turns
+// into a single summary message once the history's approximate word count
+// exceeds historyTokenBudget. The summary is only used to build this
+// turn's prompt; the original rows stay in DefraDB untouched.
+func condenseSessionHistory(ctx context.Context, history []chatMessageRow, modelName string) ([]chatMessageRow, error) {
+	if approxWordCount(history) <= historyTokenBudget || len(history) <= keepRecentTurns {
+		return history, nil
+	}
+
+	older := history[:len(history)-keepRecentTurns]
+	recent := history[len(history)-keepRecentTurns:]
+
+	summary, err := summarizeHistory(ctx, older, modelName)
+	if err != nil {
+		return nil, err
+	}
+
+	condensed := make([]chatMessageRow, 0, len(recent)+1)
+	condensed = append(condensed, chatMessageRow{
+		role:    openai.ChatMessageRoleSystem,
+		content: "Summary of earlier conversation: " + summary,
+	})
+	return append(condensed, recent...), nil
+}
+
+func approxWordCount(rows []chatMessageRow) int {
+	n := 0
+	for _, r := range rows {
+		n += len(strings.Fields(r.content))
+	}
+	return n
+}
+
+// summarizeHistory asks the LLM to condense older turns into a short
+// summary that preserves whatever a follow-up question might still need.
+func summarizeHistory(ctx context.Context, rows []chatMessageRow, modelName string) (string, error) {
+	chatBackend, err := registry.Chat(modelName)
+	if err != nil {
+		return "", err
+	}
+
+	var transcript strings.Builder
+	for _, r := range rows {
+		fmt.Fprintf(&transcript, "%s: %s\n", r.role, r.content)
+	}
+
+	summary, err := chatBackend.Chat(ctx, []openai.ChatCompletionMessage{
+		{
+			Role:    openai.ChatMessageRoleSystem,
+			Content: "Summarize the following conversation concisely, preserving names, facts, and open questions a follow-up question might depend on.",
+		},
+		{Role: openai.ChatMessageRoleUser, Content: transcript.String()},
+	}, 0)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(summary), nil
+}